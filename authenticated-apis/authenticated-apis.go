@@ -1,22 +1,78 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
 	"os"
 
 	"github.com/aws/aws-cdk-go/awscdk"
 	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2"
 	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2authorizers"
 	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2integrations"
+	"github.com/aws/aws-cdk-go/awscdk/awscertificatemanager"
 	"github.com/aws/aws-cdk-go/awscdk/awscognito"
 	"github.com/aws/aws-cdk-go/awscdk/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/awsroute53"
 	"github.com/aws/aws-cdk-go/awscdk/awss3assets"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
 )
 
+const (
+	// cognitoDomainPrefix is the Cognito hosted UI domain prefix, shared by
+	// the stack definition and the OpenAPI emitter so the two stay in sync.
+	cognitoDomainPrefix = "authenticated-apis-app"
+
+	// productsResourceServerIdentifier is the OAuth resource server
+	// identifier products scopes are namespaced under.
+	productsResourceServerIdentifier = "com.example.api.backend"
+)
+
+// AuthorizerMode selects how the HTTP API authorizes requests.
+type AuthorizerMode string
+
+const (
+	// AuthorizerModeCognitoUserPool validates the caller's Cognito JWT
+	// directly against the user pool. This is the default.
+	AuthorizerModeCognitoUserPool AuthorizerMode = "CognitoUserPool"
+
+	// AuthorizerModeLambdaRequest delegates the authorization decision to a
+	// Lambda request authorizer backed by a custom claims table in DynamoDB.
+	AuthorizerModeLambdaRequest AuthorizerMode = "LambdaRequest"
+)
+
 type AuthenticatedApisStackProps struct {
 	awscdk.StackProps
+
+	// DefaultAuthorizer, when set, overrides the stack's own Cognito user pool
+	// authorizer as the HTTP API's default authorizer.
+	DefaultAuthorizer awsapigatewayv2.IHttpRouteAuthorizer
+
+	// DefaultAuthorizationScopes, when set, overrides the stack's own
+	// products:* scope as the HTTP API's default authorization scopes.
+	DefaultAuthorizationScopes *[]*string
+
+	// AuthorizerMode selects between the stack's own Cognito user pool
+	// authorizer (the default) and a Lambda request authorizer. Ignored when
+	// DefaultAuthorizer is set.
+	AuthorizerMode AuthorizerMode
+
+	// HostedZoneName and DomainName, when both set, front the HTTP API with a
+	// CloudFront distribution on this custom domain. The API Gateway URL
+	// stays enabled and is still output. HostedZoneName must identify a Route 53
+	// public hosted zone already present in the account. Because CloudFront
+	// only accepts ACM certificates (and CLOUDFRONT-scope WAF web ACLs) from
+	// us-east-1, the stack's Env.Region must be us-east-1 whenever these are
+	// set, regardless of where everything else in the stack lives.
+	HostedZoneName *string
+	DomainName     *string
+
+	// EnableWaf attaches a rate-limiting WAF web ACL to the CloudFront
+	// distribution. Only takes effect when HostedZoneName/DomainName are set.
+	EnableWaf *bool
 }
 
 func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *AuthenticatedApisStackProps) awscdk.Stack {
@@ -43,9 +99,6 @@ func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *Aut
 	})
 	productsTable.GrantReadWriteData(productsApiFunction)
 
-	httpApi := awsapigatewayv2.NewHttpApi(stack, jsii.String("ProductsApi"), &awsapigatewayv2.HttpApiProps{
-		CreateDefaultStage: jsii.Bool(true),
-	})
 	lambdaProxyIntegration := awsapigatewayv2integrations.NewHttpLambdaIntegration(
 		jsii.String("HttpLambdaIntegration"),
 		productsApiFunction,
@@ -69,9 +122,39 @@ func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *Aut
 			},
 		},
 	})
+
+	// NOTE: an earlier revision of this stack tried to drive the access
+	// token's scope claim entirely from group membership, via a single app
+	// client plus a pre-token-generation Lambda trigger that overrode scope
+	// based on which of these groups a user belonged to. That's not
+	// implementable on this CDK/CloudFormation version: LambdaConfig's
+	// PreTokenGeneration field only wires the classic V1 trigger (there's no
+	// PreTokenGenerationConfig/LambdaVersion field to opt into V2), and V1's
+	// claimsOverrideDetails can only override ID token claims — it has no
+	// hook into the access token at all. So there is no CloudFormation
+	// resource this stack can create that turns "user is in ProductsAdmins"
+	// into "access token has scope products:*".
+	//
+	// These groups are therefore informational only, surfaced to admins in
+	// the Cognito console and in the ID token's cognito:groups claim, so
+	// it's easy to see which app client a given user is expected to sign in
+	// through. They grant nothing by themselves, and nothing in this stack
+	// automatically adds a user to one on sign-up: actual scope enforcement
+	// comes from which app client (below) a user authenticates with, since
+	// that's the one mechanism Cognito does enforce.
+	productsReadersGroup := awscognito.NewCfnUserPoolGroup(stack, jsii.String("ProductsReadersGroup"), &awscognito.CfnUserPoolGroupProps{
+		UserPoolId:  pool.UserPoolId(),
+		GroupName:   jsii.String("ProductsReaders"),
+		Description: jsii.String("Members sign in through the read-only app client and receive the products:read scope"),
+	})
+	productsAdminsGroup := awscognito.NewCfnUserPoolGroup(stack, jsii.String("ProductsAdminsGroup"), &awscognito.CfnUserPoolGroupProps{
+		UserPoolId:  pool.UserPoolId(),
+		GroupName:   jsii.String("ProductsAdmins"),
+		Description: jsii.String("Members sign in through the full-access app client and receive the products:* scope"),
+	})
 	domain := pool.AddDomain(jsii.String("Domain"), &awscognito.UserPoolDomainOptions{
 		CognitoDomain: &awscognito.CognitoDomainOptions{
-			DomainPrefix: jsii.String("authenticated-apis-app"),
+			DomainPrefix: jsii.String(cognitoDomainPrefix),
 		},
 	})
 	productReadOnlyScope := awscognito.NewResourceServerScope(&awscognito.ResourceServerScopeProps{
@@ -83,9 +166,13 @@ func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *Aut
 		ScopeDescription: jsii.String("Create, retrieve, modify, delete production information"),
 	})
 	resourceServer := pool.AddResourceServer(jsii.String("BackendApi"), &awscognito.UserPoolResourceServerOptions{
-		Identifier: jsii.String("com.example.api.backend"),
+		Identifier: jsii.String(productsResourceServerIdentifier),
 		Scopes:     &[]awscognito.ResourceServerScope{productReadOnlyScope, productFullAccessScope},
 	})
+	// Scope enforcement lives entirely in which app client a user
+	// authenticates with: the read-only client is never configured with
+	// products:*, so it structurally cannot obtain it, regardless of what a
+	// caller asks for in the /oauth2/authorize request.
 	readOnlyClient := pool.AddClient(jsii.String("ProductsReadOnlyApiClient"), &awscognito.UserPoolClientOptions{
 		OAuth: &awscognito.OAuthSettings{
 			CallbackUrls: jsii.Strings(*domain.BaseUrl(&awscognito.BaseUrlOptions{})),
@@ -112,46 +199,74 @@ func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *Aut
 			},
 		},
 	})
-	authorizer := awsapigatewayv2authorizers.NewHttpUserPoolAuthorizer(
+	defaultAuthorizer := awsapigatewayv2.IHttpRouteAuthorizer(awsapigatewayv2authorizers.NewHttpUserPoolAuthorizer(
 		jsii.String("PoolAuthorizer"),
 		pool,
 		&awsapigatewayv2authorizers.HttpUserPoolAuthorizerProps{
 			UserPoolClients: &[]awscognito.IUserPoolClient{readOnlyClient, fullAccessClient},
 		},
-	)
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:        jsii.String("/products"),
-		Methods:     &[]awsapigatewayv2.HttpMethod{"POST"},
-		Integration: lambdaProxyIntegration,
-		Authorizer:  authorizer,
-		AuthorizationScopes: jsii.Strings(
-			*resourceServer.UserPoolResourceServerId() + "/products:*",
-		),
-	})
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:        jsii.String("/products/{productId}"),
-		Methods:     &[]awsapigatewayv2.HttpMethod{"PUT", "DELETE"},
-		Integration: lambdaProxyIntegration,
-		Authorizer:  authorizer,
-		AuthorizationScopes: jsii.Strings(
-			*resourceServer.UserPoolResourceServerId() + "/products:*",
-		),
-	})
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:        jsii.String("/products/{productId}"),
-		Methods:     &[]awsapigatewayv2.HttpMethod{"GET"},
-		Integration: lambdaProxyIntegration,
-		Authorizer:  authorizer,
-		AuthorizationScopes: jsii.Strings(
-			*resourceServer.UserPoolResourceServerId()+"/products:*",
-			*resourceServer.UserPoolResourceServerId()+"/products:read",
-		),
-	})
+	))
+	// AuthorizationScopes is a JWT-authorizer concept: API Gateway v2 only
+	// accepts it alongside a JWT authorizer, not the Lambda REQUEST
+	// authorizer addRequestAuthorizer wires up (which enforces scopes itself
+	// via REQUIRED_SCOPES_BY_ROUTE instead).
+	authorizerSupportsScopes := true
+	if props != nil && props.AuthorizerMode == AuthorizerModeLambdaRequest && props.DefaultAuthorizer == nil {
+		defaultAuthorizer = addRequestAuthorizer(stack, pool, productRouteSpecs())
+		authorizerSupportsScopes = false
+	}
+
+	var defaultAuthorizationScopes *[]*string
+	if authorizerSupportsScopes {
+		defaultAuthorizationScopes = jsii.Strings(*resourceServer.UserPoolResourceServerId() + "/products:*")
+	}
+	if props != nil {
+		if props.DefaultAuthorizer != nil {
+			defaultAuthorizer = props.DefaultAuthorizer
+		}
+		if props.DefaultAuthorizationScopes != nil {
+			defaultAuthorizationScopes = props.DefaultAuthorizationScopes
+		}
+	}
+
+	var edgeZone awsroute53.IHostedZone
+	var edgeCertificate awscertificatemanager.ICertificate
+	var edgeDomainName awsapigatewayv2.IDomainName
+	if props != nil && props.HostedZoneName != nil && props.DomainName != nil {
+		if sprops.Env != nil && sprops.Env.Region != nil && *sprops.Env.Region != "" && *sprops.Env.Region != "us-east-1" {
+			panic(fmt.Sprintf("HostedZoneName/DomainName require Env.Region to be us-east-1 (CloudFront only accepts ACM certificates and CLOUDFRONT-scope WAF web ACLs from there), got %q", *sprops.Env.Region))
+		}
+		edgeZone, edgeCertificate, edgeDomainName = newCustomDomain(stack, *props.HostedZoneName, *props.DomainName)
+	}
+
+	httpApiProps := &awsapigatewayv2.HttpApiProps{
+		CreateDefaultStage:         jsii.Bool(true),
+		DefaultAuthorizer:          defaultAuthorizer,
+		DefaultAuthorizationScopes: defaultAuthorizationScopes,
+	}
+	if edgeDomainName != nil {
+		httpApiProps.DefaultDomainMapping = &awsapigatewayv2.DomainMappingOptions{DomainName: edgeDomainName}
+	}
+	httpApi := awsapigatewayv2.NewHttpApi(stack, jsii.String("ProductsApi"), httpApiProps)
+	addProductRoutes(httpApi, lambdaProxyIntegration, resourceServer, authorizerSupportsScopes)
+
+	identityPool := addIdentityPool(stack, pool, []awscognito.IUserPoolClient{readOnlyClient, fullAccessClient}, productsTable)
+
+	var cloudFrontUrl *string
+	if edgeDomainName != nil {
+		enableWaf := props.EnableWaf != nil && *props.EnableWaf
+		cloudFrontUrl = addEdge(stack, edgeZone, edgeCertificate, edgeDomainName, *props.DomainName, enableWaf)
+	}
 
 	// Outputs
 	awscdk.NewCfnOutput(stack, jsii.String("ProductsApiUrl"), &awscdk.CfnOutputProps{
 		Value: httpApi.Url(),
 	})
+	if cloudFrontUrl != nil {
+		awscdk.NewCfnOutput(stack, jsii.String("ProductsApiCloudFrontUrl"), &awscdk.CfnOutputProps{
+			Value: cloudFrontUrl,
+		})
+	}
 	awscdk.NewCfnOutput(stack, jsii.String("ProductsReadOnlyCognitoSignInUrl"), &awscdk.CfnOutputProps{
 		Value: domain.SignInUrl(readOnlyClient, &awscognito.SignInUrlOptions{
 			RedirectUri: domain.BaseUrl(&awscognito.BaseUrlOptions{}),
@@ -162,19 +277,178 @@ func NewAuthenticatedApisStack(scope constructs.Construct, id string, props *Aut
 			RedirectUri: domain.BaseUrl(&awscognito.BaseUrlOptions{}),
 		}),
 	})
+	awscdk.NewCfnOutput(stack, jsii.String("IdentityPoolId"), &awscdk.CfnOutputProps{
+		Value: identityPool.Ref(),
+	})
+	awscdk.NewCfnOutput(stack, jsii.String("ProductsReadersGroupName"), &awscdk.CfnOutputProps{
+		Value: productsReadersGroup.GroupName(),
+	})
+	awscdk.NewCfnOutput(stack, jsii.String("ProductsAdminsGroupName"), &awscdk.CfnOutputProps{
+		Value: productsAdminsGroup.GroupName(),
+	})
 
 	return stack
 }
 
+// addIdentityPool creates a Cognito identity pool backed by pool's app
+// clients, so that browser/mobile clients which have already signed in can
+// exchange their user pool tokens for temporary AWS credentials instead of
+// always going through API Gateway. Authenticated users are granted
+// dynamodb:Query and dynamodb:GetItem on the whole products table; access is
+// not restricted per user.
+func addIdentityPool(stack awscdk.Stack, pool awscognito.UserPool, clients []awscognito.IUserPoolClient, productsTable awsdynamodb.Table) awscognito.CfnIdentityPool {
+	providers := make([]interface{}, len(clients))
+	for i, client := range clients {
+		providers[i] = &awscognito.CfnIdentityPool_CognitoIdentityProviderProperty{
+			ClientId:     client.UserPoolClientId(),
+			ProviderName: pool.UserPoolProviderName(),
+		}
+	}
+	identityPool := awscognito.NewCfnIdentityPool(stack, jsii.String("IdentityPool"), &awscognito.CfnIdentityPoolProps{
+		AllowUnauthenticatedIdentities: jsii.Bool(false),
+		CognitoIdentityProviders:       &providers,
+	})
+
+	unauthenticatedRole := awsiam.NewRole(stack, jsii.String("CognitoUnauthenticatedRole"), &awsiam.RoleProps{
+		AssumedBy: awsiam.NewFederatedPrincipal(
+			jsii.String("cognito-identity.amazonaws.com"),
+			&map[string]interface{}{
+				"StringEquals": map[string]interface{}{
+					"cognito-identity.amazonaws.com:aud": identityPool.Ref(),
+				},
+				"ForAnyValue:StringLike": map[string]interface{}{
+					"cognito-identity.amazonaws.com:amr": "unauthenticated",
+				},
+			},
+			jsii.String("sts:AssumeRoleWithWebIdentity"),
+		),
+	})
+	authenticatedRole := awsiam.NewRole(stack, jsii.String("CognitoAuthenticatedRole"), &awsiam.RoleProps{
+		AssumedBy: awsiam.NewFederatedPrincipal(
+			jsii.String("cognito-identity.amazonaws.com"),
+			&map[string]interface{}{
+				"StringEquals": map[string]interface{}{
+					"cognito-identity.amazonaws.com:aud": identityPool.Ref(),
+				},
+				"ForAnyValue:StringLike": map[string]interface{}{
+					"cognito-identity.amazonaws.com:amr": "authenticated",
+				},
+			},
+			jsii.String("sts:AssumeRoleWithWebIdentity"),
+		),
+	})
+	productsTable.Grant(authenticatedRole, jsii.String("dynamodb:Query"), jsii.String("dynamodb:GetItem"))
+
+	awscognito.NewCfnIdentityPoolRoleAttachment(stack, jsii.String("IdentityPoolRoleAttachment"), &awscognito.CfnIdentityPoolRoleAttachmentProps{
+		IdentityPoolId: identityPool.Ref(),
+		Roles: &map[string]interface{}{
+			"authenticated":   authenticatedRole.RoleArn(),
+			"unauthenticated": unauthenticatedRole.RoleArn(),
+		},
+	})
+
+	return identityPool
+}
+
+// RouteSpec describes one products route. It is the single source of truth
+// shared by addProductRoutes, which wires it onto the HTTP API, and the
+// OpenAPI emitter, which documents it — so the two can never drift apart.
+type RouteSpec struct {
+	Path    string
+	Methods []string
+	Scopes  []string
+}
+
+// productRouteSpecs is the full set of routes the products API exposes.
+// Scopes lists every scope a caller may present; a route with more than one
+// scope is the exception that must override the HTTP API's default
+// authorization scopes, since the default only covers products:*.
+func productRouteSpecs() []RouteSpec {
+	return []RouteSpec{
+		{Path: "/products", Methods: []string{"POST"}, Scopes: []string{"products:*"}},
+		{Path: "/products/{productId}", Methods: []string{"PUT", "DELETE"}, Scopes: []string{"products:*"}},
+		{Path: "/products/{productId}", Methods: []string{"GET"}, Scopes: []string{"products:*", "products:read"}},
+	}
+}
+
+// addProductRoutes wires productRouteSpecs onto httpApi. POST and PUT/DELETE
+// rely entirely on the HTTP API's default authorizer and default
+// authorization scopes (products:*); GET is the one exception, widening the
+// required scopes to also accept products:read. authorizeWithScopes must be
+// false when the default authorizer isn't JWT-based (AuthorizationScopes is
+// rejected by API Gateway v2 for any other authorizer type), in which case
+// routes carry no per-route scope override at all.
+func addProductRoutes(httpApi awsapigatewayv2.HttpApi, integration awsapigatewayv2.HttpRouteIntegration, resourceServer awscognito.IUserPoolResourceServer, authorizeWithScopes bool) []RouteSpec {
+	specs := productRouteSpecs()
+	for _, spec := range specs {
+		options := &awsapigatewayv2.AddRoutesOptions{
+			Path:        jsii.String(spec.Path),
+			Methods:     httpMethods(spec.Methods),
+			Integration: integration,
+		}
+		if authorizeWithScopes && len(spec.Scopes) > 1 {
+			options.AuthorizationScopes = resourceServerScopes(resourceServer, spec.Scopes)
+		}
+		httpApi.AddRoutes(options)
+	}
+	return specs
+}
+
+func httpMethods(methods []string) *[]awsapigatewayv2.HttpMethod {
+	result := make([]awsapigatewayv2.HttpMethod, len(methods))
+	for i, method := range methods {
+		result[i] = awsapigatewayv2.HttpMethod(method)
+	}
+	return &result
+}
+
+func resourceServerScopes(resourceServer awscognito.IUserPoolResourceServer, scopes []string) *[]*string {
+	result := make([]*string, len(scopes))
+	for i, scope := range scopes {
+		result[i] = jsii.String(*resourceServer.UserPoolResourceServerId() + "/" + scope)
+	}
+	return &result
+}
+
+// requiredScopesByRouteKey flattens routes into a map from HTTP API route key
+// (e.g. "GET /products/{productId}") to the scopes a caller may present, any
+// one of which is enough.
+// AuthorizationScopes is a JWT-authorizer concept that HTTP API never
+// forwards to a Lambda REQUEST authorizer's invocation event, so this is the
+// channel addRequestAuthorizer uses to give its Lambda the same per-route
+// scope requirements addProductRoutes gives the Cognito user pool authorizer.
+func requiredScopesByRouteKey(routes []RouteSpec) map[string][]string {
+	result := map[string][]string{}
+	for _, route := range routes {
+		for _, method := range route.Methods {
+			result[method+" "+route.Path] = route.Scopes
+		}
+	}
+	return result
+}
+
 func main() {
+	emitOpenAPIPath := flag.String("emit-openapi", "", "in addition to synthesizing, write an OpenAPI 3.0 spec for the products API to this path")
+	flag.Parse()
+
 	app := awscdk.NewApp(nil)
 
 	NewAuthenticatedApisStack(app, "AuthenticatedApisStack", &AuthenticatedApisStackProps{
-		awscdk.StackProps{
+		StackProps: awscdk.StackProps{
 			Env: env(),
 		},
 	})
 
+	if *emitOpenAPIPath != "" {
+		region := os.Getenv("CDK_DEFAULT_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		if err := writeOpenAPISpec(*emitOpenAPIPath, cognitoDomainPrefix, region); err != nil {
+			log.Fatalf("emit-openapi: %v", err)
+		}
+	}
+
 	app.Synth(nil)
 }
 
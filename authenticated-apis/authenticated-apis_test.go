@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/jsii-runtime-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
 )
@@ -31,4 +32,141 @@ func TestAuthenticatedApisStack(t *testing.T) {
 	assert.NotNil(t, addProductFunction)
 	addProductApiRoute := template.Get("Resources.ProductsApiPUTproducts*.Properties.RouteKey")
 	assert.Equal(t, "PUT /products", addProductApiRoute.String())
+
+	postRoute := template.Get("Resources.ProductsApiPOSTproducts*.Properties")
+	putRoute := template.Get("Resources.ProductsApiPUTproductsproductId*.Properties")
+	deleteRoute := template.Get("Resources.ProductsApiDELETEproductsproductId*.Properties")
+	getRoute := template.Get("Resources.ProductsApiGETproductsproductId*.Properties")
+
+	defaultAuthorizerId := postRoute.Get("AuthorizerId").String()
+	assert.NotEmpty(t, defaultAuthorizerId)
+	assert.Equal(t, defaultAuthorizerId, putRoute.Get("AuthorizerId").String())
+	assert.Equal(t, defaultAuthorizerId, deleteRoute.Get("AuthorizerId").String())
+	assert.Equal(t, defaultAuthorizerId, getRoute.Get("AuthorizerId").String())
+
+	assert.Len(t, postRoute.Get("AuthorizationScopes").Array(), 1)
+	assert.Len(t, putRoute.Get("AuthorizationScopes").Array(), 1)
+	assert.Len(t, deleteRoute.Get("AuthorizationScopes").Array(), 1)
+
+	getScopes := getRoute.Get("AuthorizationScopes").Array()
+	assert.Len(t, getScopes, 2)
+	assert.Contains(t, getScopes[0].Raw+getScopes[1].Raw, "products:*")
+	assert.Contains(t, getScopes[0].Raw+getScopes[1].Raw, "products:read")
+
+	readOnlyClientScopes := template.Get("Resources.PoolProductsReadOnlyApiClient*.Properties.AllowedOAuthScopes")
+	assert.Contains(t, readOnlyClientScopes.Raw, "/products:read")
+	assert.NotContains(t, readOnlyClientScopes.Raw, "/products:*")
+
+	readersGroup := template.Get("Resources.ProductsReadersGroup.Properties.GroupName")
+	assert.Equal(t, "ProductsReaders", readersGroup.String())
+	adminsGroup := template.Get("Resources.ProductsAdminsGroup.Properties.GroupName")
+	assert.Equal(t, "ProductsAdmins", adminsGroup.String())
+
+	authorizerType := template.Get("Resources.ProductsApiPoolAuthorizer*.Properties.AuthorizerType")
+	assert.Equal(t, "JWT", authorizerType.String())
+
+	// Scope enforcement comes entirely from which app client a user
+	// authenticates with (asserted above): this CDK version has no way to
+	// wire a trigger that rewrites the access token's scope claim from group
+	// membership, so the pool must not declare one. See the NOTE above
+	// productsReadersGroup/productsAdminsGroup in authenticated-apis.go.
+	userPool := template.Get(`Resources.@values.#(Type=="AWS::Cognito::UserPool").Properties`)
+	assert.False(t, userPool.Get("LambdaConfig").Exists())
+}
+
+func TestAuthenticatedApisStack_EdgeRequiresUsEast1(t *testing.T) {
+	// GIVEN
+	app := awscdk.NewApp(nil)
+
+	// WHEN/THEN
+	assert.Panics(t, func() {
+		NewAuthenticatedApisStack(app, "MyStack", &AuthenticatedApisStackProps{
+			StackProps: awscdk.StackProps{
+				Env: &awscdk.Environment{Region: jsii.String("us-west-2")},
+			},
+			HostedZoneName: jsii.String("example.com"),
+			DomainName:     jsii.String("api.example.com"),
+		})
+	})
+}
+
+func TestAuthenticatedApisStack_CustomDomain(t *testing.T) {
+	// GIVEN
+	app := awscdk.NewApp(nil)
+
+	// WHEN
+	stack := NewAuthenticatedApisStack(app, "MyStack", &AuthenticatedApisStackProps{
+		StackProps: awscdk.StackProps{
+			Env: &awscdk.Environment{Region: jsii.String("us-east-1"), Account: jsii.String("123456789012")},
+		},
+		HostedZoneName: jsii.String("example.com"),
+		DomainName:     jsii.String("api.example.com"),
+	})
+
+	// THEN
+	bytes, err := json.Marshal(app.Synth(nil).GetStackArtifact(stack.ArtifactId()).Template())
+	if err != nil {
+		t.Error(err)
+	}
+
+	template := gjson.ParseBytes(bytes)
+
+	domainName := template.Get(`Resources.@values.#(Type=="AWS::ApiGatewayV2::DomainName").Properties`)
+	assert.Equal(t, "api.example.com", domainName.Get("DomainName").String())
+
+	// The domain is attached via HttpApiProps.DefaultDomainMapping rather
+	// than a standalone ApiMapping constructed after the fact, so there
+	// should be exactly one ApiMapping, mapping the default stage.
+	mappings := template.Get(`Resources.@values.#(Type=="AWS::ApiGatewayV2::ApiMapping")#.Properties`).Array()
+	assert.Len(t, mappings, 1)
+	assert.Equal(t, "$default", mappings[0].Get("Stage").String())
+}
+
+func TestAuthenticatedApisStack_LambdaRequestAuthorizer(t *testing.T) {
+	// GIVEN
+	app := awscdk.NewApp(nil)
+
+	// WHEN
+	stack := NewAuthenticatedApisStack(app, "MyStack", &AuthenticatedApisStackProps{
+		AuthorizerMode: AuthorizerModeLambdaRequest,
+	})
+
+	// THEN
+	bytes, err := json.Marshal(app.Synth(nil).GetStackArtifact(stack.ArtifactId()).Template())
+	if err != nil {
+		t.Error(err)
+	}
+
+	template := gjson.ParseBytes(bytes)
+
+	authorizerType := template.Get("Resources.ProductsApiRequestAuthorizer*.Properties.AuthorizerType")
+	assert.Equal(t, "REQUEST", authorizerType.String())
+
+	cacheTtl := template.Get("Resources.ProductsApiRequestAuthorizer*.Properties.AuthorizerResultTtlInSeconds")
+	assert.Equal(t, int64(300), cacheTtl.Int())
+
+	postRoute := template.Get("Resources.ProductsApiPOSTproducts*.Properties")
+	assert.NotEmpty(t, postRoute.Get("AuthorizerId").String())
+	assert.False(t, postRoute.Get("AuthorizationScopes").Exists())
+
+	putRoute := template.Get("Resources.ProductsApiPUTproductsproductId*.Properties")
+	assert.False(t, putRoute.Get("AuthorizationScopes").Exists())
+
+	deleteRoute := template.Get("Resources.ProductsApiDELETEproductsproductId*.Properties")
+	assert.False(t, deleteRoute.Get("AuthorizationScopes").Exists())
+
+	getRoute := template.Get("Resources.ProductsApiGETproductsproductId*.Properties")
+	assert.False(t, getRoute.Get("AuthorizationScopes").Exists())
+
+	// AuthorizationScopes is a JWT-authorizer-only concept; API Gateway v2
+	// rejects it for a Lambda REQUEST authorizer, so the HTTP API itself must
+	// not carry DefaultAuthorizationScopes either when this mode is selected.
+	apiProps := template.Get(`Resources.@values.#(Type=="AWS::ApiGatewayV2::Api").Properties`)
+	assert.False(t, apiProps.Get("DefaultAuthorizationScopes").Exists())
+
+	requiredScopesByRoute := template.Get("Resources.RequestAuthorizer*.Properties.Environment.Variables.REQUIRED_SCOPES_BY_ROUTE").String()
+	var requiredScopes map[string][]string
+	assert.NoError(t, json.Unmarshal([]byte(requiredScopesByRoute), &requiredScopes))
+	assert.Equal(t, []string{"products:*"}, requiredScopes["POST /products"])
+	assert.Equal(t, []string{"products:*", "products:read"}, requiredScopes["GET /products/{productId}"])
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2"
+	"github.com/aws/aws-cdk-go/awscdk/awscertificatemanager"
+	"github.com/aws/aws-cdk-go/awscdk/awscloudfront"
+	"github.com/aws/aws-cdk-go/awscdk/awscloudfrontorigins"
+	"github.com/aws/aws-cdk-go/awscdk/awsroute53"
+	"github.com/aws/aws-cdk-go/awscdk/awsroute53targets"
+	"github.com/aws/aws-cdk-go/awscdk/awswafv2"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// newCustomDomain creates the ACM certificate and API Gateway custom domain
+// name that front the HTTP API on domainName. It must run before the HttpApi
+// is constructed so the result can be wired in via
+// HttpApiProps.DefaultDomainMapping, rather than mapped on after the fact.
+func newCustomDomain(stack awscdk.Stack, hostedZoneName, domainName string) (awsroute53.IHostedZone, awscertificatemanager.ICertificate, awsapigatewayv2.IDomainName) {
+	zone := awsroute53.HostedZone_FromLookup(stack, jsii.String("HostedZone"), &awsroute53.HostedZoneProviderProps{
+		DomainName: jsii.String(hostedZoneName),
+	})
+	certificate := awscertificatemanager.NewCertificate(stack, jsii.String("Certificate"), &awscertificatemanager.CertificateProps{
+		DomainName: jsii.String(domainName),
+		Validation: awscertificatemanager.CertificateValidation_FromDns(zone),
+	})
+	apiDomainName := awsapigatewayv2.NewDomainName(stack, jsii.String("ApiDomainName"), &awsapigatewayv2.DomainNameProps{
+		DomainName:  jsii.String(domainName),
+		Certificate: certificate,
+	})
+	return zone, certificate, apiDomainName
+}
+
+// addEdge fronts apiDomainName with a CloudFront distribution, optionally
+// protected by a rate-limiting WAF web ACL, and points domainName's DNS
+// record at it. It returns the distribution's URL.
+//
+// The certificate and (if enabled) the WAF web ACL are both resources
+// CloudFront requires to live in us-east-1 regardless of the stack's own
+// region, so this can only be called from a stack deployed there; callers
+// are responsible for enforcing that before reaching this point.
+func addEdge(stack awscdk.Stack, zone awsroute53.IHostedZone, certificate awscertificatemanager.ICertificate, apiDomainName awsapigatewayv2.IDomainName, domainName string, enableWaf bool) *string {
+	var webAclArn *string
+	if enableWaf {
+		webAclArn = addWebAcl(stack).AttrArn()
+	}
+
+	distribution := awscloudfront.NewDistribution(stack, jsii.String("Distribution"), &awscloudfront.DistributionProps{
+		DefaultBehavior: &awscloudfront.BehaviorOptions{
+			Origin: awscloudfrontorigins.NewHttpOrigin(apiDomainName.RegionalDomainName(), &awscloudfrontorigins.HttpOriginProps{}),
+		},
+		DomainNames: jsii.Strings(domainName),
+		Certificate: certificate,
+		WebAclId:    webAclArn,
+	})
+	awsroute53.NewARecord(stack, jsii.String("DistributionAliasRecord"), &awsroute53.ARecordProps{
+		Zone:       zone,
+		RecordName: jsii.String(domainName),
+		Target:     awsroute53.RecordTarget_FromAlias(awsroute53targets.NewCloudFrontTarget(distribution)),
+	})
+
+	return jsii.String("https://" + *distribution.DistributionDomainName())
+}
+
+// addWebAcl creates a CloudFront-scoped web ACL with an IP rate-based rule
+// and the AWS managed common rule set, the minimum viable protection for a
+// public-facing API. A CLOUDFRONT-scope web ACL can only be created in
+// us-east-1, same as the certificate addEdge builds alongside it.
+func addWebAcl(stack awscdk.Stack) awswafv2.CfnWebACL {
+	return awswafv2.NewCfnWebACL(stack, jsii.String("WebAcl"), &awswafv2.CfnWebACLProps{
+		DefaultAction: &awswafv2.CfnWebACL_DefaultActionProperty{
+			Allow: &awswafv2.CfnWebACL_AllowActionProperty{},
+		},
+		Scope: jsii.String("CLOUDFRONT"),
+		VisibilityConfig: &awswafv2.CfnWebACL_VisibilityConfigProperty{
+			CloudWatchMetricsEnabled: jsii.Bool(true),
+			MetricName:               jsii.String("ProductsApiWebAcl"),
+			SampledRequestsEnabled:   jsii.Bool(true),
+		},
+		Rules: &[]interface{}{
+			&awswafv2.CfnWebACL_RuleProperty{
+				Name:     jsii.String("RateLimit"),
+				Priority: jsii.Number(0),
+				Action: &awswafv2.CfnWebACL_RuleActionProperty{
+					Block: &awswafv2.CfnWebACL_BlockActionProperty{},
+				},
+				Statement: &awswafv2.CfnWebACL_StatementProperty{
+					RateBasedStatement: &awswafv2.CfnWebACL_RateBasedStatementProperty{
+						AggregateKeyType: jsii.String("IP"),
+						Limit:            jsii.Number(2000),
+					},
+				},
+				VisibilityConfig: &awswafv2.CfnWebACL_VisibilityConfigProperty{
+					CloudWatchMetricsEnabled: jsii.Bool(true),
+					MetricName:               jsii.String("ProductsApiRateLimit"),
+					SampledRequestsEnabled:   jsii.Bool(true),
+				},
+			},
+			&awswafv2.CfnWebACL_RuleProperty{
+				Name:     jsii.String("AWSManagedRulesCommonRuleSet"),
+				Priority: jsii.Number(1),
+				OverrideAction: &awswafv2.CfnWebACL_OverrideActionProperty{
+					None: map[string]interface{}{},
+				},
+				Statement: &awswafv2.CfnWebACL_StatementProperty{
+					ManagedRuleGroupStatement: &awswafv2.CfnWebACL_ManagedRuleGroupStatementProperty{
+						Name:       jsii.String("AWSManagedRulesCommonRuleSet"),
+						VendorName: jsii.String("AWS"),
+					},
+				},
+				VisibilityConfig: &awswafv2.CfnWebACL_VisibilityConfigProperty{
+					CloudWatchMetricsEnabled: jsii.Bool(true),
+					MetricName:               jsii.String("ProductsApiManagedRules"),
+					SampledRequestsEnabled:   jsii.Bool(true),
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// openAPIDocument is a minimal OpenAPI 3.0 document, covering just enough of
+// the spec to describe the products API's paths and its Cognito OAuth2
+// security scheme.
+type openAPIDocument struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       openAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components components                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type operation struct {
+	Security  []map[string][]string `json:"security"`
+	Responses map[string]response   `json:"responses"`
+}
+
+type response struct {
+	Description string `json:"description"`
+}
+
+type components struct {
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type  string     `json:"type"`
+	Flows oauthFlows `json:"flows"`
+}
+
+type oauthFlows struct {
+	AuthorizationCode oauthFlow `json:"authorizationCode"`
+}
+
+type oauthFlow struct {
+	AuthorizationUrl string            `json:"authorizationUrl"`
+	TokenUrl         string            `json:"tokenUrl"`
+	Scopes           map[string]string `json:"scopes"`
+}
+
+const productsSecurityScheme = "cognitoUserPool"
+
+// buildOpenAPIDocument turns routes into an OpenAPI 3.0 document describing
+// the products API, with an OAuth2 security scheme pointing at the Cognito
+// domain identified by domainPrefix and region.
+func buildOpenAPIDocument(routes []RouteSpec, domainPrefix, region string) openAPIDocument {
+	domain := fmt.Sprintf("https://%s.auth.%s.amazoncognito.com", domainPrefix, region)
+
+	scopes := map[string]string{
+		"products:*":    "Create, retrieve, modify, delete production information",
+		"products:read": "Retrieve product information",
+	}
+
+	paths := map[string]map[string]operation{}
+	for _, route := range routes {
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]operation{}
+		}
+		security := []map[string][]string{
+			{productsSecurityScheme: route.Scopes},
+		}
+		for _, method := range route.Methods {
+			paths[route.Path][strings.ToLower(method)] = operation{
+				Security: security,
+				Responses: map[string]response{
+					"200": {Description: "Successful response"},
+				},
+			}
+		}
+	}
+
+	return openAPIDocument{
+		OpenAPI: "3.0.0",
+		Info: openAPIInfo{
+			Title:   "Products API",
+			Version: "1.0.0",
+		},
+		Paths: paths,
+		Components: components{
+			SecuritySchemes: map[string]securityScheme{
+				productsSecurityScheme: {
+					Type: "oauth2",
+					Flows: oauthFlows{
+						AuthorizationCode: oauthFlow{
+							AuthorizationUrl: domain + "/oauth2/authorize",
+							TokenUrl:         domain + "/oauth2/token",
+							Scopes:           scopes,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// writeOpenAPISpec renders the products API's OpenAPI document and writes it
+// to path.
+func writeOpenAPISpec(path, domainPrefix, region string) error {
+	doc := buildOpenAPIDocument(productRouteSpecs(), domainPrefix, region)
+	bytes, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0644)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOpenAPISpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+
+	err := writeOpenAPISpec(path, "authenticated-apis-app", "us-east-1")
+	assert.NoError(t, err)
+
+	bytes, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(bytes, &doc))
+
+	authorizationUrl := doc["components"].(map[string]interface{})["securitySchemes"].(map[string]interface{})["cognitoUserPool"].(map[string]interface{})["flows"].(map[string]interface{})["authorizationCode"].(map[string]interface{})["authorizationUrl"]
+	assert.Equal(t, "https://authenticated-apis-app.auth.us-east-1.amazoncognito.com/oauth2/authorize", authorizationUrl)
+
+	paths := doc["paths"].(map[string]interface{})
+	products := paths["/products"].(map[string]interface{})
+	postScopes := products["post"].(map[string]interface{})["security"].([]interface{})[0].(map[string]interface{})["cognitoUserPool"].([]interface{})
+	assert.Equal(t, []interface{}{"products:*"}, postScopes)
+
+	productById := paths["/products/{productId}"].(map[string]interface{})
+	getScopes := productById["get"].(map[string]interface{})["security"].([]interface{})[0].(map[string]interface{})["cognitoUserPool"].([]interface{})
+	assert.Equal(t, []interface{}{"products:*", "products:read"}, getScopes)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2"
+	"github.com/aws/aws-cdk-go/awscdk/awsapigatewayv2authorizers"
+	"github.com/aws/aws-cdk-go/awscdk/awscognito"
+	"github.com/aws/aws-cdk-go/awscdk/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/awss3assets"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// addRequestAuthorizer creates a Lambda request authorizer for deployments
+// that select AuthorizerModeLambdaRequest: it validates the caller's Cognito
+// JWT itself and layers on a lookup against a custom claims table in
+// DynamoDB, for authorization decisions a plain Cognito user pool authorizer
+// can't express. Results are cached for 5 minutes per identity source.
+//
+// HTTP API never forwards AuthorizationScopes to a Lambda REQUEST
+// authorizer's invocation event the way it does for a JWT authorizer, so
+// routes' required scopes are instead baked into the function's environment
+// as a route-key-to-scopes table, letting it enforce the same scope model as
+// the Cognito user pool authorizer.
+func addRequestAuthorizer(stack awscdk.Stack, pool awscognito.UserPool, routes []RouteSpec) awsapigatewayv2.IHttpRouteAuthorizer {
+	claimsTable := awsdynamodb.NewTable(stack, jsii.String("AuthorizerClaimsTable"), &awsdynamodb.TableProps{
+		PartitionKey:  &awsdynamodb.Attribute{Name: jsii.String("subject"), Type: awsdynamodb.AttributeType_STRING},
+		BillingMode:   awsdynamodb.BillingMode_PAY_PER_REQUEST,
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
+	requiredScopesByRoute, err := json.Marshal(requiredScopesByRouteKey(routes))
+	if err != nil {
+		panic(err)
+	}
+
+	authorizerFunction := awslambda.NewFunction(stack, jsii.String("RequestAuthorizer"), &awslambda.FunctionProps{
+		Runtime: awslambda.Runtime_NODEJS_14_X(),
+		Code:    awslambda.AssetCode_FromAsset(jsii.String("lambda/auth/request-authorizer/function.zip"), &awss3assets.AssetOptions{}),
+		Handler: jsii.String("request-authorizer.handler"),
+		Environment: &map[string]*string{
+			"USER_POOL_ID":             pool.UserPoolId(),
+			"CLAIMS_TABLE":             claimsTable.TableName(),
+			"REQUIRED_SCOPES_BY_ROUTE": jsii.String(string(requiredScopesByRoute)),
+		},
+	})
+	claimsTable.GrantReadData(authorizerFunction)
+
+	return awsapigatewayv2authorizers.NewHttpLambdaAuthorizer(
+		jsii.String("RequestAuthorizer"),
+		authorizerFunction,
+		&awsapigatewayv2authorizers.HttpLambdaAuthorizerProps{
+			ResponseTypes:   &[]awsapigatewayv2authorizers.HttpLambdaResponseType{awsapigatewayv2authorizers.HttpLambdaResponseType_SIMPLE},
+			ResultsCacheTtl: awscdk.Duration_Minutes(jsii.Number(5)),
+		},
+	)
+}